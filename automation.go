@@ -0,0 +1,234 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Condition is a single rule trigger condition, matching the bridge's
+// /rules condition JSON shape.
+type Condition struct {
+	Address  string `json:"address"`
+	Operator string `json:"operator"`
+	Value    string `json:"value,omitempty"`
+}
+
+// ConditionBuilder builds a Condition against a sensor's state.
+type ConditionBuilder struct {
+	address string
+}
+
+// SensorState starts a Condition on the given sensor id's presence state.
+func SensorState(id string) *ConditionBuilder {
+	return &ConditionBuilder{address: "/sensors/" + id + "/state/presence"}
+}
+
+// Equals builds a Condition requiring the sensor state to equal value.
+func (b *ConditionBuilder) Equals(value bool) Condition {
+	return Condition{Address: b.address, Operator: "eq", Value: strconv.FormatBool(value)}
+}
+
+// Changed builds a Condition that fires whenever the sensor state changes.
+func (b *ConditionBuilder) Changed() Condition {
+	return Condition{Address: b.address, Operator: "dx"}
+}
+
+// Action is a single rule or schedule action, matching the bridge's
+// actions/command JSON shape.
+type Action struct {
+	Address string      `json:"address"`
+	Method  string      `json:"method"`
+	Body    interface{} `json:"body"`
+}
+
+// SetGroup builds an Action that PUTs state to a group's action endpoint.
+func SetGroup(id string, state *PutLightRequest) Action {
+	return Action{Address: "/groups/" + id + "/action", Method: "PUT", Body: state}
+}
+
+// SetLight builds an Action that PUTs state to a single light.
+func SetLight(id string, state *PutLightRequest) Action {
+	return Action{Address: "/lights/" + id + "/state", Method: "PUT", Body: state}
+}
+
+// RuleBuilder fluently builds a bridge rule:
+// NewRule().When(SensorState("1").Equals(true)).Then(SetGroup("1", state)).Create(ctx, hue).
+type RuleBuilder struct {
+	name       string
+	conditions []Condition
+	actions    []Action
+}
+
+// NewRule starts building a new rule.
+func NewRule() *RuleBuilder {
+	return &RuleBuilder{}
+}
+
+// Named sets the rule's display name.
+func (b *RuleBuilder) Named(name string) *RuleBuilder {
+	b.name = name
+	return b
+}
+
+// When adds trigger conditions to the rule. All conditions must hold for
+// the rule's actions to fire.
+func (b *RuleBuilder) When(conditions ...Condition) *RuleBuilder {
+	b.conditions = append(b.conditions, conditions...)
+	return b
+}
+
+// Then adds actions to run when the rule's conditions are met.
+func (b *RuleBuilder) Then(actions ...Action) *RuleBuilder {
+	b.actions = append(b.actions, actions...)
+	return b
+}
+
+type createRuleRequest struct {
+	Name       string      `json:"name,omitempty"`
+	Conditions []Condition `json:"conditions"`
+	Actions    []Action    `json:"actions"`
+}
+
+type createRuleResponse []struct {
+	Success struct {
+		Id string `json:"id"`
+	}
+}
+
+// Create compiles the rule's conditions and actions into the JSON the
+// bridge expects and POSTs it to /api/{user}/rules, returning the new
+// rule's id.
+func (b *RuleBuilder) Create(ctx context.Context, hue *Hue) (string, error) {
+	path := "/api/" + hue.UserName + "/rules"
+
+	reqBody := &createRuleRequest{Name: b.name, Conditions: b.conditions, Actions: b.actions}
+
+	var respBody createRuleResponse
+	if err := hue.post(ctx, path, reqBody, &respBody); err != nil {
+		log.Printf("Failed to create rule: %v", err)
+		return "", err
+	}
+
+	if len(respBody) == 0 {
+		err := fmt.Errorf("No id returned when creating rule")
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	return respBody[0].Success.Id, nil
+}
+
+// CaptureScene stores the current state of the given lights as a new scene,
+// via CreateScene, then reads each light's current state via GetLight and
+// pushes it into the scene with PUT /scenes/{id}/lightstates/{id} so that
+// Scene.Apply can later restore them in a single group recall.
+func (hue *Hue) CaptureScene(ctx context.Context, name string, lights []string) (string, error) {
+
+	id, err := hue.CreateScene(ctx, name, lights)
+	if err != nil {
+		return "", err
+	}
+
+	path := "/api/" + hue.UserName + "/scenes/" + id + "/lightstates/"
+
+	for _, lightId := range lights {
+		var light GetLightResponse
+		if err := hue.GetLight(ctx, lightId, &light); err != nil {
+			log.Printf("Failed to capture state of light %v for scene %v: %v", lightId, id, err)
+			return id, err
+		}
+
+		state := &PutLightRequest{
+			On:    &light.State.On,
+			Hue:   &light.State.Hue,
+			Sat:   &light.State.Sat,
+			Bri:   &light.State.Bri,
+			CT:    &light.State.CT,
+			Alert: &light.State.Alert,
+		}
+		if len(light.State.XY) == 2 {
+			xy := [2]float64{light.State.XY[0], light.State.XY[1]}
+			state.XY = &xy
+		}
+
+		var stateResp putLightResponse
+		if err := hue.put(ctx, path+lightId, state, &stateResp); err != nil {
+			log.Printf("Failed to store state of light %v in scene %v: %v", lightId, id, err)
+			return id, err
+		}
+	}
+
+	return id, nil
+}
+
+// ScheduleBuilder fluently builds a bridge schedule:
+// NewSchedule().At(t).Do(SetGroup("1", state)).Create(ctx, hue).
+type ScheduleBuilder struct {
+	name string
+	time time.Time
+	cmd  Action
+}
+
+// NewSchedule starts building a new schedule.
+func NewSchedule() *ScheduleBuilder {
+	return &ScheduleBuilder{}
+}
+
+// Named sets the schedule's display name.
+func (b *ScheduleBuilder) Named(name string) *ScheduleBuilder {
+	b.name = name
+	return b
+}
+
+// At sets the time the schedule should fire.
+func (b *ScheduleBuilder) At(t time.Time) *ScheduleBuilder {
+	b.time = t
+	return b
+}
+
+// Do sets the action to run when the schedule fires.
+func (b *ScheduleBuilder) Do(action Action) *ScheduleBuilder {
+	b.cmd = action
+	return b
+}
+
+type createScheduleRequest struct {
+	Name      string `json:"name,omitempty"`
+	LocalTime string `json:"localtime"`
+	Command   Action `json:"command"`
+}
+
+type createScheduleResponse []struct {
+	Success struct {
+		Id string `json:"id"`
+	}
+}
+
+// Create compiles the schedule into the JSON the bridge expects and POSTs
+// it to /api/{user}/schedules, returning the new schedule's id.
+func (b *ScheduleBuilder) Create(ctx context.Context, hue *Hue) (string, error) {
+	path := "/api/" + hue.UserName + "/schedules"
+
+	reqBody := &createScheduleRequest{
+		Name:      b.name,
+		LocalTime: b.time.Format("2006-01-02T15:04:05"),
+		Command:   b.cmd,
+	}
+
+	var respBody createScheduleResponse
+	if err := hue.post(ctx, path, reqBody, &respBody); err != nil {
+		log.Printf("Failed to create schedule: %v", err)
+		return "", err
+	}
+
+	if len(respBody) == 0 {
+		err := fmt.Errorf("No id returned when creating schedule")
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	return respBody[0].Success.Id, nil
+}
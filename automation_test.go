@@ -0,0 +1,100 @@
+package hue
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSensorStateCondition(t *testing.T) {
+	tests := []struct {
+		name string
+		cond Condition
+		want Condition
+	}{
+		{
+			name: "equals true",
+			cond: SensorState("1").Equals(true),
+			want: Condition{Address: "/sensors/1/state/presence", Operator: "eq", Value: "true"},
+		},
+		{
+			name: "equals false",
+			cond: SensorState("2").Equals(false),
+			want: Condition{Address: "/sensors/2/state/presence", Operator: "eq", Value: "false"},
+		},
+		{
+			name: "changed",
+			cond: SensorState("3").Changed(),
+			want: Condition{Address: "/sensors/3/state/presence", Operator: "dx"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.cond != test.want {
+				t.Errorf("got %+v, want %+v", test.cond, test.want)
+			}
+		})
+	}
+}
+
+func TestSetGroupAndSetLightActions(t *testing.T) {
+	on := true
+	state := &PutLightRequest{On: &on}
+
+	group := SetGroup("living-room", state)
+	if group.Address != "/groups/living-room/action" || group.Method != "PUT" || group.Body != state {
+		t.Errorf("SetGroup(...) = %+v, want address /groups/living-room/action, method PUT, body state", group)
+	}
+
+	light := SetLight("1", state)
+	if light.Address != "/lights/1/state" || light.Method != "PUT" || light.Body != state {
+		t.Errorf("SetLight(...) = %+v, want address /lights/1/state, method PUT, body state", light)
+	}
+}
+
+func TestRuleBuilderCompilesToExpectedJSON(t *testing.T) {
+	on := true
+	state := &PutLightRequest{On: &on}
+
+	b := NewRule().Named("motion light").
+		When(SensorState("motion-1").Equals(true)).
+		Then(SetGroup("living-room", state))
+
+	reqBody := &createRuleRequest{Name: b.name, Conditions: b.conditions, Actions: b.actions}
+
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	want := `{"name":"motion light","conditions":[{"address":"/sensors/motion-1/state/presence","operator":"eq","value":"true"}],"actions":[{"address":"/groups/living-room/action","method":"PUT","body":{"on":true}}]}`
+	if string(data) != want {
+		t.Errorf("got JSON %s, want %s", data, want)
+	}
+}
+
+func TestScheduleBuilderCompilesToExpectedJSON(t *testing.T) {
+	on := true
+	state := &PutLightRequest{On: &on}
+
+	at := time.Date(2026, time.July, 29, 22, 30, 0, 0, time.UTC)
+
+	b := NewSchedule().Named("bedtime").At(at).Do(SetGroup("bedroom", state))
+
+	reqBody := &createScheduleRequest{
+		Name:      b.name,
+		LocalTime: b.time.Format("2006-01-02T15:04:05"),
+		Command:   b.cmd,
+	}
+
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	want := `{"name":"bedtime","localtime":"2026-07-29T22:30:00","command":{"address":"/groups/bedroom/action","method":"PUT","body":{"on":true}}}`
+	if string(data) != want {
+		t.Errorf("got JSON %s, want %s", data, want)
+	}
+}
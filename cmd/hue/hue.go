@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	. "github.com/bklimt/hue"
 	"log"
+	"strconv"
 	"strings"
 )
 
@@ -18,6 +22,8 @@ func main() {
 	hue := flag.Int("hue", -1, "Hue to set lights to.")
 	sat := flag.Int("sat", -1, "Saturation to set lights to.")
 	bri := flag.Int("bri", -1, "Brightness to set lights to.")
+	rgb := flag.String("rgb", "", "RGB color to set lights to, as a hex string like #ffaa00.")
+	kelvin := flag.Int("kelvin", -1, "Color temperature in Kelvin to set lights to.")
 
 	light := flag.String("light", "", "Light to set properties of.")
 
@@ -25,12 +31,21 @@ func main() {
 
 	philipsHue := FromFlags()
 
+	ctx := context.Background()
+
+	if philipsHue.IpAddress == "" {
+		bridges, err := Discover(ctx)
+		if err != nil {
+			log.Fatalf("Unable to discover Hue bridge: %v", err)
+		}
+		log.Printf("Discovered %v Hue bridge(s), using %v", len(bridges), bridges[0].IpAddress)
+		philipsHue.IpAddress = bridges[0].IpAddress
+	}
+
 	if *register {
-		if err := philipsHue.PostUser(); err != nil {
-			if hueErr, ok := err.(*HueError); ok {
-				if hueErr.Type == 101 {
-					log.Fatalf("Please press the link button on the router and then try again.")
-				}
+		if err := philipsHue.PostUser(ctx); err != nil {
+			if errors.Is(err, ErrLinkButtonNotPressed) {
+				log.Fatalf("Please press the link button on the router and then try again.")
 			}
 			log.Fatalf("Unable to register user: %v", err)
 		}
@@ -38,7 +53,7 @@ func main() {
 
 	if *dumpUserInfo {
 		userInfo := &GetUserResponse{}
-		if err := philipsHue.GetUser(userInfo); err != nil {
+		if err := philipsHue.GetUser(ctx, userInfo); err != nil {
 			log.Fatalf("Unable to fetch user info: %v", err)
 		}
 	}
@@ -49,14 +64,14 @@ func main() {
 		lights = append(lights, *light)
 	} else {
 		lightsInfo := &GetLightsResponse{}
-		if err := philipsHue.GetLights(lightsInfo); err != nil {
+		if err := philipsHue.GetLights(ctx, lightsInfo); err != nil {
 			log.Fatalf("Unable to fetch lights: %v", err)
 		}
 		for lightName, _ := range *lightsInfo {
 			lights = append(lights, lightName)
 
 			lightInfo := &GetLightResponse{}
-			if err := philipsHue.GetLight(lightName, lightInfo); err != nil {
+			if err := philipsHue.GetLight(ctx, lightName, lightInfo); err != nil {
 				log.Fatalf("Unable to fetch light: %v", err)
 			}
 		}
@@ -74,10 +89,34 @@ func main() {
 	if *bri >= 0 {
 		state.Bri = bri
 	}
-
-	for _, lightName := range lights {
-		if err := philipsHue.PutLight(lightName, state); err != nil {
-			log.Fatalf("Unable to change light %v: %v", lightName, err)
+	if *rgb != "" {
+		r, g, b, err := parseRGB(*rgb)
+		if err != nil {
+			log.Fatalf("Invalid --rgb value %q: %v", *rgb, err)
 		}
+		state.SetRGB(r, g, b)
+	}
+	if *kelvin > 0 {
+		state.SetKelvin(*kelvin)
+	}
+
+	if err := philipsHue.PutLights(ctx, lights, state); err != nil {
+		log.Fatalf("Unable to change lights: %v", err)
+	}
+}
+
+// parseRGB parses a hex RGB string, with or without a leading "#", into its
+// red, green and blue components.
+func parseRGB(s string) (r, g, b uint8, err error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return 0, 0, 0, fmt.Errorf("expected 6 hex digits, got %q", s)
 	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
 }
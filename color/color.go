@@ -0,0 +1,145 @@
+// Package color converts between sRGB, CIE 1931 xy chromaticity, and the
+// mired color temperature values used by the Hue bridge's light state API.
+package color
+
+import "math"
+
+// Gamut is a triangle of CIE 1931 xy chromaticity points describing the
+// subset of the color space a Hue bulb model can reproduce.
+type Gamut struct {
+	Red, Green, Blue [2]float64
+}
+
+// GamutA, GamutB and GamutC are the gamut triangles published by
+// Philips/Signify for Hue light models A, B and C respectively.
+var (
+	GamutA = Gamut{
+		Red:   [2]float64{0.7040, 0.2960},
+		Green: [2]float64{0.2151, 0.7106},
+		Blue:  [2]float64{0.1380, 0.0800},
+	}
+	GamutB = Gamut{
+		Red:   [2]float64{0.6750, 0.3220},
+		Green: [2]float64{0.4090, 0.5180},
+		Blue:  [2]float64{0.1670, 0.0400},
+	}
+	GamutC = Gamut{
+		Red:   [2]float64{0.6920, 0.3080},
+		Green: [2]float64{0.1700, 0.7000},
+		Blue:  [2]float64{0.1530, 0.0480},
+	}
+)
+
+// RGBToXY converts an 8-bit sRGB color to CIE 1931 (x, y) chromaticity and
+// relative luminance Y, gamma-correcting to linear RGB, applying the Wide
+// RGB D65 matrix, and clamping (x, y) into gamut.
+func RGBToXY(r, g, b uint8, gamut Gamut) (x, y, Y float64) {
+	rl := gammaCorrect(float64(r) / 255)
+	gl := gammaCorrect(float64(g) / 255)
+	bl := gammaCorrect(float64(b) / 255)
+
+	X := rl*0.4124 + gl*0.3576 + bl*0.1805
+	Y = rl*0.2126 + gl*0.7152 + bl*0.0722
+	Z := rl*0.0193 + gl*0.1192 + bl*0.9505
+
+	sum := X + Y + Z
+	if sum == 0 {
+		return gamut.Blue[0], gamut.Blue[1], 0
+	}
+
+	x, y = clampToGamut(X/sum, Y/sum, gamut)
+	return x, y, Y
+}
+
+// gammaCorrect converts a single sRGB component in [0, 1] to linear RGB.
+func gammaCorrect(c float64) float64 {
+	if c > 0.04045 {
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+	return c / 12.92
+}
+
+// KelvinToMired converts a color temperature in Kelvin to the mired value
+// used by the bridge's ct field. Kelvin must be positive; non-positive
+// values return 0 instead of panicking on the divide-by-zero.
+func KelvinToMired(kelvin int) int {
+	if kelvin <= 0 {
+		return 0
+	}
+	return 1000000 / kelvin
+}
+
+// MiredToKelvin converts a mired value, as used by the bridge's ct field,
+// back to a color temperature in Kelvin. Mired must be positive; non-positive
+// values return 0 instead of panicking on the divide-by-zero.
+func MiredToKelvin(mired int) int {
+	if mired <= 0 {
+		return 0
+	}
+	return 1000000 / mired
+}
+
+// clampToGamut projects (x, y) onto the nearest point of gamut's triangle if
+// it falls outside it, and returns it unchanged otherwise.
+func clampToGamut(x, y float64, gamut Gamut) (float64, float64) {
+	p := [2]float64{x, y}
+	if inTriangle(p, gamut) {
+		return x, y
+	}
+
+	candidates := [][2]float64{
+		closestOnSegment(gamut.Red, gamut.Green, p),
+		closestOnSegment(gamut.Green, gamut.Blue, p),
+		closestOnSegment(gamut.Blue, gamut.Red, p),
+	}
+
+	closest := candidates[0]
+	closestDist := distance(p, closest)
+	for _, c := range candidates[1:] {
+		if d := distance(p, c); d < closestDist {
+			closest, closestDist = c, d
+		}
+	}
+
+	return closest[0], closest[1]
+}
+
+// inTriangle reports whether p lies inside (or on the edge of) the triangle
+// formed by gamut's three vertices.
+func inTriangle(p [2]float64, gamut Gamut) bool {
+	d1 := sign(p, gamut.Red, gamut.Green)
+	d2 := sign(p, gamut.Green, gamut.Blue)
+	d3 := sign(p, gamut.Blue, gamut.Red)
+
+	hasNeg := d1 < 0 || d2 < 0 || d3 < 0
+	hasPos := d1 > 0 || d2 > 0 || d3 > 0
+
+	return !(hasNeg && hasPos)
+}
+
+func sign(p1, p2, p3 [2]float64) float64 {
+	return (p1[0]-p3[0])*(p2[1]-p3[1]) - (p2[0]-p3[0])*(p1[1]-p3[1])
+}
+
+// closestOnSegment returns the point on the line segment a-b closest to p.
+func closestOnSegment(a, b, p [2]float64) [2]float64 {
+	abx, aby := b[0]-a[0], b[1]-a[1]
+	lengthSq := abx*abx + aby*aby
+	if lengthSq == 0 {
+		return a
+	}
+
+	t := ((p[0]-a[0])*abx + (p[1]-a[1])*aby) / lengthSq
+	if t < 0 {
+		t = 0
+	} else if t > 1 {
+		t = 1
+	}
+
+	return [2]float64{a[0] + t*abx, a[1] + t*aby}
+}
+
+func distance(a, b [2]float64) float64 {
+	dx, dy := a[0]-b[0], a[1]-b[1]
+	return math.Sqrt(dx*dx + dy*dy)
+}
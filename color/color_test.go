@@ -0,0 +1,97 @@
+package color
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKelvinToMired(t *testing.T) {
+	tests := []struct {
+		name   string
+		kelvin int
+		want   int
+	}{
+		{"2700k warm white", 2700, 370},
+		{"6500k daylight", 6500, 153},
+		{"zero is invalid", 0, 0},
+		{"negative is invalid", -100, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := KelvinToMired(test.kelvin); got != test.want {
+				t.Errorf("KelvinToMired(%v) = %v, want %v", test.kelvin, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMiredToKelvin(t *testing.T) {
+	tests := []struct {
+		name  string
+		mired int
+		want  int
+	}{
+		{"370 mired", 370, 2702},
+		{"153 mired", 153, 6535},
+		{"zero is invalid", 0, 0},
+		{"negative is invalid", -1, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := MiredToKelvin(test.mired); got != test.want {
+				t.Errorf("MiredToKelvin(%v) = %v, want %v", test.mired, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRGBToXYClampsToGamut(t *testing.T) {
+	tests := []struct {
+		name       string
+		r, g, b    uint8
+		gamut      Gamut
+		wantInside bool
+	}{
+		{"pure red in gamut B", 255, 0, 0, GamutB, true},
+		{"pure green in gamut C", 0, 255, 0, GamutC, true},
+		{"black stays in gamut A", 0, 0, 0, GamutA, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			x, y, Y := RGBToXY(test.r, test.g, test.b, test.gamut)
+			if !inTriangle([2]float64{x, y}, test.gamut) {
+				t.Errorf("RGBToXY(%v, %v, %v) = (%v, %v), not inside gamut triangle %+v", test.r, test.g, test.b, x, y, test.gamut)
+			}
+			if Y < 0 || Y > 1 {
+				t.Errorf("RGBToXY(%v, %v, %v) luminance Y = %v, want in [0, 1]", test.r, test.g, test.b, Y)
+			}
+		})
+	}
+}
+
+func TestClampToGamutProjectsOutsidePoints(t *testing.T) {
+	// A point far outside any real gamut should be projected onto the
+	// nearest edge of the triangle, not returned unchanged.
+	x, y := clampToGamut(10, 10, GamutB)
+	if inTriangle([2]float64{10, 10}, GamutB) {
+		t.Fatalf("test point unexpectedly inside gamut B")
+	}
+	if !inTriangle([2]float64{x, y}, GamutB) {
+		t.Errorf("clampToGamut(10, 10) = (%v, %v), want a point inside gamut B's triangle", x, y)
+	}
+}
+
+func TestClampToGamutLeavesInsidePointsUnchanged(t *testing.T) {
+	// The centroid of gamut B's triangle is inside it, so clamping
+	// should be a no-op.
+	cx := (GamutB.Red[0] + GamutB.Green[0] + GamutB.Blue[0]) / 3
+	cy := (GamutB.Red[1] + GamutB.Green[1] + GamutB.Blue[1]) / 3
+
+	x, y := clampToGamut(cx, cy, GamutB)
+	if math.Abs(x-cx) > 1e-9 || math.Abs(y-cy) > 1e-9 {
+		t.Errorf("clampToGamut(%v, %v) = (%v, %v), want unchanged", cx, cy, x, y)
+	}
+}
@@ -0,0 +1,240 @@
+package hue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ssdpAddress      = "239.255.255.250:1900"
+	ssdpSearchTarget = "ssdp:all"
+	ssdpTimeout      = 5 * time.Second
+	nupnpUrl         = "https://discovery.meethue.com/"
+)
+
+// bridgeDescription is the subset of a Hue bridge's UPnP description.xml
+// needed to identify it.
+type bridgeDescription struct {
+	Device struct {
+		FriendlyName string `xml:"friendlyName"`
+		Manufacturer string `xml:"manufacturer"`
+		ModelName    string `xml:"modelName"`
+		SerialNumber string `xml:"serialNumber"`
+	} `xml:"device"`
+}
+
+// hueManufacturer and hueModelPrefix identify a genuine Hue bridge's
+// description.xml, per https://developers.meethue.com/develop/get-started-2/,
+// so that SSDP M-SEARCH (which uses ST: ssdp:all and so hears back from any
+// UPnP device on the LAN) doesn't mistake some other device for a bridge.
+const (
+	hueManufacturer = "Royal Philips Electronics"
+	hueModelPrefix  = "Philips hue bridge"
+)
+
+// isHueBridge reports whether desc describes a genuine Hue bridge, rather
+// than some other UPnP device that happened to answer the M-SEARCH.
+func isHueBridge(desc bridgeDescription) bool {
+	return desc.Device.Manufacturer == hueManufacturer || strings.HasPrefix(desc.Device.ModelName, hueModelPrefix)
+}
+
+// nupnpEntry is a single record returned by the N-UPnP discovery service.
+type nupnpEntry struct {
+	Id                string `json:"id"`
+	InternalIpAddress string `json:"internalipaddress"`
+}
+
+// discoveredBridge pairs a bridge's serial number with the Hue instance used
+// to talk to it, so that SSDP and N-UPnP results can be deduped.
+type discoveredBridge struct {
+	serial string
+	hue    Hue
+}
+
+// Discover locates Hue bridges on the local network, so that callers don't
+// have to hard-code the bridge's IP address with --hue_ip. It tries SSDP
+// M-SEARCH first, then always also queries the N-UPnP discovery service at
+// discovery.meethue.com, merging and deduping the results by the bridge's
+// serial number.
+func Discover(ctx context.Context) ([]Hue, error) {
+	found := make(map[string]Hue)
+
+	for _, bridge := range discoverSsdp(ctx) {
+		found[bridge.serial] = bridge.hue
+	}
+
+	nupnpBridges, err := discoverNupnp(ctx)
+	if err != nil {
+		log.Printf("N-UPnP discovery failed: %v", err)
+	}
+	for _, bridge := range nupnpBridges {
+		if _, ok := found[bridge.serial]; !ok {
+			found[bridge.serial] = bridge.hue
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("No Hue bridges found")
+	}
+
+	bridges := make([]Hue, 0, len(found))
+	for _, b := range found {
+		bridges = append(bridges, b)
+	}
+
+	return bridges, nil
+}
+
+// discoverSsdp sends an SSDP M-SEARCH multicast and collects the LOCATION of
+// every bridge that responds before ctx's deadline (or ssdpTimeout) elapses.
+func discoverSsdp(ctx context.Context) []discoveredBridge {
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		log.Printf("Failed to resolve SSDP multicast address: %v", err)
+		return nil
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		log.Printf("Failed to open UDP socket for SSDP discovery: %v", err)
+		return nil
+	}
+	defer conn.Close()
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddress + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 3\r\n" +
+		"ST: " + ssdpSearchTarget + "\r\n\r\n"
+
+	if _, err := conn.WriteTo([]byte(search), addr); err != nil {
+		log.Printf("Failed to send SSDP M-SEARCH: %v", err)
+		return nil
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(ssdpTimeout)
+	}
+	conn.SetReadDeadline(deadline)
+
+	locations := make(map[string]bool)
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+
+		if location := parseSsdpLocation(buf[:n]); location != "" {
+			locations[location] = true
+		}
+	}
+
+	fetchCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	bridges := make([]discoveredBridge, 0, len(locations))
+	for location := range locations {
+		bridge, err := fetchSsdpBridge(fetchCtx, location)
+		if err != nil {
+			log.Printf("Failed to fetch bridge description from %v: %v", location, err)
+			continue
+		}
+		bridges = append(bridges, bridge)
+	}
+
+	return bridges
+}
+
+// parseSsdpLocation extracts the LOCATION header from a raw SSDP response.
+func parseSsdpLocation(data []byte) string {
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(string(data))), nil)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	return resp.Header.Get("LOCATION")
+}
+
+// fetchSsdpBridge GETs a bridge's description.xml to recover its serial
+// number, pairing it with a Hue instance pointed at the IP from location. It
+// rejects any response that isn't from a genuine Hue bridge, since ST:
+// ssdp:all draws responses from every UPnP device on the LAN.
+func fetchSsdpBridge(ctx context.Context, location string) (discoveredBridge, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return discoveredBridge{}, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return discoveredBridge{}, err
+	}
+	defer resp.Body.Close()
+
+	var desc bridgeDescription
+	if err := xml.NewDecoder(resp.Body).Decode(&desc); err != nil {
+		return discoveredBridge{}, err
+	}
+
+	if !isHueBridge(desc) {
+		return discoveredBridge{}, fmt.Errorf("%v is not a Hue bridge (manufacturer %q, model %q)", location, desc.Device.Manufacturer, desc.Device.ModelName)
+	}
+
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return discoveredBridge{}, err
+	}
+	ip := parsed.Hostname()
+
+	serial := desc.Device.SerialNumber
+	if serial == "" {
+		serial = ip
+	}
+
+	return discoveredBridge{
+		serial: serial,
+		hue:    Hue{IpAddress: ip, UserName: userName, DeviceType: deviceType},
+	}, nil
+}
+
+// discoverNupnp queries the N-UPnP fallback discovery service, which
+// remembers bridges that have previously phoned home to Philips' servers.
+func discoverNupnp(ctx context.Context) ([]discoveredBridge, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", nupnpUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var entries []nupnpEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	bridges := make([]discoveredBridge, 0, len(entries))
+	for _, entry := range entries {
+		bridges = append(bridges, discoveredBridge{
+			serial: entry.Id,
+			hue:    Hue{IpAddress: entry.InternalIpAddress, UserName: userName, DeviceType: deviceType},
+		})
+	}
+
+	return bridges, nil
+}
@@ -0,0 +1,293 @@
+package hue
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	eventStreamInitialBackoff = 1 * time.Second
+	eventStreamMaxBackoff     = 30 * time.Second
+)
+
+// EventType identifies the kind of update carried by an Event.
+type EventType string
+
+const (
+	EventLight       EventType = "light"
+	EventMotion      EventType = "motion"
+	EventButton      EventType = "button"
+	EventTemperature EventType = "temperature"
+)
+
+// Event is a single update delivered on the channel returned by Subscribe.
+// Exactly one of the typed fields matching Type is populated.
+type Event struct {
+	Type        EventType
+	Light       *LightUpdate
+	Motion      *MotionUpdate
+	Button      *ButtonEvent
+	Temperature *TemperatureUpdate
+}
+
+// LightUpdate reports a change in a light's on/off or brightness state.
+type LightUpdate struct {
+	Id  string
+	On  *bool
+	Bri *int
+}
+
+// MotionUpdate reports a change in a motion sensor's reading.
+type MotionUpdate struct {
+	Id     string
+	Motion bool
+}
+
+// ButtonEvent reports a physical button or dimmer switch press.
+type ButtonEvent struct {
+	Id     string
+	Button string
+}
+
+// TemperatureUpdate reports a change in a temperature sensor's reading.
+type TemperatureUpdate struct {
+	Id          string
+	Temperature float64
+}
+
+// EventStream subscribes to a Hue bridge's CLIP v2 SSE event stream and
+// delivers decoded events on a channel, reconnecting with exponential
+// backoff if the connection drops. The bridge's cert CN is its bridge id,
+// so RootCAs should hold a pool containing that cert, or
+// InsecureSkipVerify can be set to skip verification entirely.
+type EventStream struct {
+	Hue                *Hue
+	RootCAs            *x509.CertPool
+	InsecureSkipVerify bool
+}
+
+// Subscribe starts streaming events from the bridge using the default
+// EventStream options. The returned channel is closed when ctx is done.
+func (hue *Hue) Subscribe(ctx context.Context) (<-chan Event, error) {
+	return (&EventStream{Hue: hue}).Subscribe(ctx)
+}
+
+// Subscribe starts streaming events from the bridge. The returned channel
+// is closed when ctx is done.
+func (es *EventStream) Subscribe(ctx context.Context) (<-chan Event, error) {
+	events := make(chan Event)
+	go es.run(ctx, events)
+	return events, nil
+}
+
+func (es *EventStream) run(ctx context.Context, events chan<- Event) {
+	defer close(events)
+
+	backoff := eventStreamInitialBackoff
+	lastEventId := ""
+
+	for ctx.Err() == nil {
+		nextEventId, err := es.stream(ctx, lastEventId, events)
+		if nextEventId != "" {
+			lastEventId = nextEventId
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Event stream disconnected, reconnecting in %v: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)))/2):
+		}
+
+		backoff *= 2
+		if backoff > eventStreamMaxBackoff {
+			backoff = eventStreamMaxBackoff
+		}
+	}
+}
+
+// stream makes a single connection attempt and reads frames from it until
+// the connection drops or ctx is done, returning the last seen SSE event id
+// so the caller can resume with Last-Event-ID on reconnect.
+func (es *EventStream) stream(ctx context.Context, lastEventId string, events chan<- Event) (string, error) {
+	url := "https://" + es.Hue.IpAddress + "/eventstream/clip/v2"
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return lastEventId, err
+	}
+	req.Header.Set("hue-application-key", es.Hue.UserName)
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventId != "" {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:            es.RootCAs,
+				InsecureSkipVerify: es.InsecureSkipVerify,
+			},
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return lastEventId, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return lastEventId, fmt.Errorf("event stream returned status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var data strings.Builder
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return lastEventId, nil
+		}
+
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id:"):
+			lastEventId = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		case line == "":
+			if data.Len() > 0 {
+				dispatchClipV2Frame(ctx, data.String(), events)
+				data.Reset()
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return lastEventId, err
+	}
+
+	return lastEventId, fmt.Errorf("event stream closed by bridge")
+}
+
+// clipV2Frame is a single SSE "data:" payload from the CLIP v2 stream,
+// carrying a batch of resource updates.
+type clipV2Frame struct {
+	Type string           `json:"type"`
+	Data []clipV2Resource `json:"data"`
+}
+
+// clipV2Resource is one changed resource within a clipV2Frame. Only the
+// fields relevant to the resource's Type are populated by the bridge.
+type clipV2Resource struct {
+	Id           string `json:"id"`
+	ResourceType string `json:"type"`
+
+	On *struct {
+		On bool `json:"on"`
+	} `json:"on,omitempty"`
+
+	Dimming *struct {
+		Brightness float64 `json:"brightness"`
+	} `json:"dimming,omitempty"`
+
+	Motion *struct {
+		Motion bool `json:"motion"`
+	} `json:"motion,omitempty"`
+
+	Button *struct {
+		LastEvent string `json:"last_event"`
+	} `json:"button,omitempty"`
+
+	Temperature *struct {
+		Temperature float64 `json:"temperature"`
+	} `json:"temperature,omitempty"`
+}
+
+// dispatchClipV2Frame decodes a raw SSE data payload and sends each
+// recognized resource update on events, giving up if ctx is done first.
+func dispatchClipV2Frame(ctx context.Context, data string, events chan<- Event) {
+	var frames []clipV2Frame
+	if err := json.Unmarshal([]byte(data), &frames); err != nil {
+		log.Printf("Failed to parse event stream frame: %v", err)
+		return
+	}
+
+	for _, frame := range frames {
+		for _, res := range frame.Data {
+			event, ok := decodeClipV2Resource(res)
+			if !ok {
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// decodeClipV2Resource converts a clipV2Resource into the typed Event the
+// caller expects, based on its ResourceType.
+func decodeClipV2Resource(res clipV2Resource) (Event, bool) {
+	switch res.ResourceType {
+	case "light":
+		update := &LightUpdate{Id: res.Id}
+		if res.On != nil {
+			on := res.On.On
+			update.On = &on
+		}
+		if res.Dimming != nil {
+			bri := int(res.Dimming.Brightness)
+			update.Bri = &bri
+		}
+		return Event{Type: EventLight, Light: update}, true
+
+	case "motion":
+		if res.Motion == nil {
+			return Event{}, false
+		}
+		return Event{
+			Type:   EventMotion,
+			Motion: &MotionUpdate{Id: res.Id, Motion: res.Motion.Motion},
+		}, true
+
+	case "button":
+		if res.Button == nil {
+			return Event{}, false
+		}
+		return Event{
+			Type:   EventButton,
+			Button: &ButtonEvent{Id: res.Id, Button: res.Button.LastEvent},
+		}, true
+
+	case "temperature":
+		if res.Temperature == nil {
+			return Event{}, false
+		}
+		return Event{
+			Type:        EventTemperature,
+			Temperature: &TemperatureUpdate{Id: res.Id, Temperature: res.Temperature.Temperature},
+		}, true
+
+	default:
+		return Event{}, false
+	}
+}
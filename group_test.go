@@ -0,0 +1,105 @@
+package hue
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestPutLightsGroupFallback(t *testing.T) {
+	t.Run("uses a temporary group for multiple lights", func(t *testing.T) {
+		var mu sync.Mutex
+		var calls []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			calls = append(calls, r.Method+" "+r.URL.Path)
+			mu.Unlock()
+
+			switch {
+			case r.Method == "POST" && r.URL.Path == "/api/testuser/groups":
+				w.Write([]byte(`[{"success":{"id":"temp1"}}]`))
+			case r.Method == "PUT" && r.URL.Path == "/api/testuser/groups/temp1/action":
+				w.Write([]byte(`[{"success":{"/groups/temp1/action/on":true}}]`))
+			case r.Method == "DELETE" && r.URL.Path == "/api/testuser/groups/temp1":
+				w.Write([]byte(`[{"success":"/groups/temp1 deleted"}]`))
+			default:
+				t.Errorf("unexpected request: %v %v", r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		hue := &Hue{IpAddress: server.Listener.Addr().String(), UserName: "testuser"}
+
+		on := true
+		if err := hue.PutLights(context.Background(), []string{"1", "2", "3"}, &PutLightRequest{On: &on}); err != nil {
+			t.Fatalf("PutLights returned error: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		want := []string{
+			"POST /api/testuser/groups",
+			"PUT /api/testuser/groups/temp1/action",
+			"DELETE /api/testuser/groups/temp1",
+		}
+		if len(calls) != len(want) {
+			t.Fatalf("calls = %v, want %v", calls, want)
+		}
+		for i, call := range calls {
+			if call != want[i] {
+				t.Errorf("calls[%d] = %v, want %v", i, call, want[i])
+			}
+		}
+	})
+
+	t.Run("falls back to per-light PUT when group creation fails", func(t *testing.T) {
+		var mu sync.Mutex
+		var calls []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			calls = append(calls, r.Method+" "+r.URL.Path)
+			mu.Unlock()
+
+			switch {
+			case r.Method == "POST" && r.URL.Path == "/api/testuser/groups":
+				w.Write([]byte(`[]`))
+			case r.Method == "PUT" && r.URL.Path == "/api/testuser/lights/1/state":
+				w.Write([]byte(`[{"success":{"/lights/1/state/on":true}}]`))
+			case r.Method == "PUT" && r.URL.Path == "/api/testuser/lights/2/state":
+				w.Write([]byte(`[{"success":{"/lights/2/state/on":true}}]`))
+			default:
+				t.Errorf("unexpected request: %v %v", r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		hue := &Hue{IpAddress: server.Listener.Addr().String(), UserName: "testuser"}
+
+		on := true
+		if err := hue.PutLights(context.Background(), []string{"1", "2"}, &PutLightRequest{On: &on}); err != nil {
+			t.Fatalf("PutLights returned error: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		want := []string{
+			"POST /api/testuser/groups",
+			"PUT /api/testuser/lights/1/state",
+			"PUT /api/testuser/lights/2/state",
+		}
+		if len(calls) != len(want) {
+			t.Fatalf("calls = %v, want %v", calls, want)
+		}
+		for i, call := range calls {
+			if call != want[i] {
+				t.Errorf("calls[%d] = %v, want %v", i, call, want[i])
+			}
+		}
+	})
+}
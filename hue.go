@@ -3,12 +3,18 @@ package hue
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
+	"time"
+
+	"github.com/bklimt/hue/color"
 )
 
 // Hue contains information for connecting to a Hue hub.
@@ -16,6 +22,18 @@ type Hue struct {
 	IpAddress  string
 	UserName   string
 	DeviceType string
+
+	// Client is the http.Client used to talk to the bridge. It defaults to
+	// http.DefaultClient; set its Transport to a RetryTransport to get
+	// automatic retries on 429/503 responses.
+	Client *http.Client
+}
+
+func (hue *Hue) client() *http.Client {
+	if hue.Client != nil {
+		return hue.Client
+	}
+	return http.DefaultClient
 }
 
 // HueError is an error returned from the Hue API.
@@ -29,6 +47,43 @@ func (err *HueError) Error() string {
 	return fmt.Sprintf("Hue Error %v: %v %v", err.Type, err.Address, err.Description)
 }
 
+// Sentinel errors for common Hue API error types, so callers can use
+// errors.Is(err, hue.ErrUnauthorizedUser) instead of type-asserting a
+// HueError and comparing its Type field by hand.
+var (
+	ErrUnauthorizedUser     = errors.New("hue: unauthorized user")
+	ErrResourceNotAvailable = errors.New("hue: resource not available")
+	ErrLinkButtonNotPressed = errors.New("hue: link button not pressed")
+	ErrDeviceOff            = errors.New("hue: device is off")
+)
+
+// hueErrorSentinels maps a HueError's Type to the sentinel error it
+// corresponds to, per https://developers.meethue.com/develop/hue-api/error-messages/.
+var hueErrorSentinels = map[int]error{
+	1:   ErrUnauthorizedUser,
+	3:   ErrResourceNotAvailable,
+	101: ErrLinkButtonNotPressed,
+	201: ErrDeviceOff,
+}
+
+// Is reports whether err is the sentinel error corresponding to this
+// HueError's Type, so that errors.Is(err, ErrLinkButtonNotPressed) works.
+func (err *HueError) Is(target error) bool {
+	return hueErrorSentinels[err.Type] == target
+}
+
+// HTTPError is returned when the bridge responds with a non-200 status. It
+// preserves the status code and raw response body, which processJsonResponse
+// used to discard.
+type HTTPError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (err *HTTPError) Error() string {
+	return fmt.Sprintf("Http request failed: status %d: %s", err.StatusCode, err.Body)
+}
+
 // HueAggregateError is a collection of multiple errors, for API calls that affect multiple lights
 // or change multiple settings.
 type HueAggregateError []struct {
@@ -50,31 +105,31 @@ var deviceType string
 
 // Flags initializes a set of flags for setting standard Hue connection options.
 func Flags() {
-	flag.StringVar(&ip, "hue_ip", "192.168.1.3", "IP Address of Philips Hue hub.")
+	flag.StringVar(&ip, "hue_ip", "", "IP Address of Philips Hue hub. Auto-discovered on the LAN if empty.")
 	flag.StringVar(&userName, "hue_username", "HueGoRaspberryPiUser", "Username for Hue hub.")
 	flag.StringVar(&deviceType, "hue_device_type", "HueGoRaspberryPi", "Device type for Hue hub.")
 }
 
 // FromFlags creates a new Hue instance using the values specified by the common flags.
 func FromFlags() *Hue {
-	return &Hue{ip, userName, deviceType}
+	return &Hue{IpAddress: ip, UserName: userName, DeviceType: deviceType}
 }
 
 func processJsonResponse(resp *http.Response, jsonBody interface{}) error {
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		err := fmt.Errorf("Http request failed: Status %d", resp.StatusCode)
-		log.Printf("%v", err)
-		return err
-	}
-
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("Failed to read response body: %v", err)
 		return err
 	}
 
+	if resp.StatusCode != 200 {
+		err := &HTTPError{StatusCode: resp.StatusCode, Body: body}
+		log.Printf("%v", err)
+		return err
+	}
+
 	// Check whether it's actually an error.
 	var hueErr HueAggregateError
 	if err = json.Unmarshal(body, &hueErr); err == nil {
@@ -98,74 +153,134 @@ func processJsonResponse(resp *http.Response, jsonBody interface{}) error {
 	return nil
 }
 
-func (hue *Hue) get(path string, jsonBody interface{}) error {
+// do issues an HTTP request of the given method against path, through
+// hue.client() so that a custom Client (e.g. one with a RetryTransport) is
+// honored, and decodes the JSON response into respBody.
+func (hue *Hue) do(ctx context.Context, method string, path string, reqBody interface{}, respBody interface{}) error {
 	url := "http://" + hue.IpAddress + path
 
-	resp, err := http.Get(url)
+	var body *bytes.Reader
+	if reqBody != nil {
+		data, err := json.Marshal(reqBody)
+		if err != nil {
+			log.Printf("Unable to create JSON for request: %v", err)
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	var req *http.Request
+	var err error
+	if body != nil {
+		req, err = http.NewRequestWithContext(ctx, method, url, body)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+	}
 	if err != nil {
-		log.Printf("Http GET failed: %v", err)
+		log.Printf("Creating %v request failed: %v", method, err)
 		return err
 	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	if err = processJsonResponse(resp, jsonBody); err != nil {
+	resp, err := hue.client().Do(req)
+	if err != nil {
+		log.Printf("Http %v failed: %v", method, err)
 		return err
 	}
 
-	return nil
+	return processJsonResponse(resp, respBody)
 }
 
-func (hue *Hue) post(path string, reqBody interface{}, respBody interface{}) error {
-	url := "http://" + hue.IpAddress + path
+func (hue *Hue) get(ctx context.Context, path string, jsonBody interface{}) error {
+	return hue.do(ctx, "GET", path, nil, jsonBody)
+}
 
-	data, err := json.Marshal(reqBody)
-	if err != nil {
-		log.Printf("Unable to create JSON for request: %v", err)
-		return err
-	}
-	reqReader := bytes.NewReader(data)
+func (hue *Hue) post(ctx context.Context, path string, reqBody interface{}, respBody interface{}) error {
+	return hue.do(ctx, "POST", path, reqBody, respBody)
+}
 
-	resp, err := http.Post(url, "application/json", reqReader)
-	if err != nil {
-		log.Printf("Http POST failed: %v", err)
-		return err
-	}
+func (hue *Hue) put(ctx context.Context, path string, reqBody interface{}, respBody interface{}) error {
+	return hue.do(ctx, "PUT", path, reqBody, respBody)
+}
 
-	if err = processJsonResponse(resp, respBody); err != nil {
-		return err
-	}
+func (hue *Hue) delete(ctx context.Context, path string, respBody interface{}) error {
+	return hue.do(ctx, "DELETE", path, nil, respBody)
+}
 
-	return nil
+type deleteResponse []struct {
+	Success string
 }
 
-func (hue *Hue) put(path string, reqBody interface{}, respBody interface{}) error {
-	url := "http://" + hue.IpAddress + path
+// RetryTransport wraps another http.RoundTripper, retrying idempotent
+// GET/PUT requests that receive a 429 or 503 response with exponential
+// backoff and jitter. Set Hue.Client.Transport to a *RetryTransport to
+// enable it; it is not used by default.
+type RetryTransport struct {
+	// Base is the underlying RoundTripper. It defaults to http.DefaultTransport.
+	Base http.RoundTripper
+
+	// MaxRetries is the number of retry attempts after the initial request.
+	// It defaults to 3.
+	MaxRetries int
+
+	// InitialBackoff is the delay before the first retry, doubling after
+	// each subsequent attempt. It defaults to 200ms.
+	InitialBackoff time.Duration
+}
 
-	data, err := json.Marshal(reqBody)
-	if err != nil {
-		log.Printf("Unable to create JSON for request: %v", err)
-		return err
+// RoundTrip implements http.RoundTripper.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
 	}
-	reqReader := bytes.NewReader(data)
 
-	req, err := http.NewRequest("PUT", url, reqReader)
-	if err != nil {
-		log.Printf("Creating PUT request failed: %v", err)
+	maxRetries := t.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = 3
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Http PUT failed: %v", err)
-		return err
+	backoff := t.InitialBackoff
+	if backoff == 0 {
+		backoff = 200 * time.Millisecond
 	}
 
-	if err = processJsonResponse(resp, respBody); err != nil {
-		return err
+	if req.Method != "GET" && req.Method != "PUT" {
+		return base.RoundTrip(req)
 	}
 
-	return nil
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return resp, err
+			}
+			req.Body = body
+		}
+
+		resp, err = base.RoundTrip(req)
+		if err != nil || (resp.StatusCode != 429 && resp.StatusCode != 503) {
+			return resp, err
+		}
+
+		if attempt >= maxRetries {
+			return resp, err
+		}
+		resp.Body.Close()
+
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+	}
 }
 
 // LightState contains the mutable state of a single light.
@@ -238,11 +353,11 @@ type GetUserResponse struct {
 }
 
 // GetUser fetches information about the user of this Hue connection.
-func (hue *Hue) GetUser(resp *GetUserResponse) error {
+func (hue *Hue) GetUser(ctx context.Context, resp *GetUserResponse) error {
 
 	path := "/api/" + hue.UserName
 
-	if err := hue.get(path, resp); err != nil {
+	if err := hue.get(ctx, path, resp); err != nil {
 		log.Printf("Failed to fetch user info: %v", err)
 		return err
 	}
@@ -262,7 +377,7 @@ type postUserResponse []struct {
 }
 
 // PostUser registers the given user with the Hue hub.
-func (hue *Hue) PostUser() error {
+func (hue *Hue) PostUser(ctx context.Context) error {
 
 	path := "/api"
 
@@ -272,7 +387,7 @@ func (hue *Hue) PostUser() error {
 	}
 
 	var respBody postUserResponse
-	if err := hue.post(path, &reqBody, &respBody); err != nil {
+	if err := hue.post(ctx, path, &reqBody, &respBody); err != nil {
 		log.Printf("Failed to register user: %v", err)
 		return err
 	}
@@ -286,11 +401,11 @@ type GetLightsResponse map[string]struct {
 }
 
 // GetLights returns some basic information about all of the lights.
-func (hue *Hue) GetLights(resp *GetLightsResponse) error {
+func (hue *Hue) GetLights(ctx context.Context, resp *GetLightsResponse) error {
 
 	path := "/api/" + hue.UserName + "/lights"
 
-	if err := hue.get(path, resp); err != nil {
+	if err := hue.get(ctx, path, resp); err != nil {
 		log.Printf("Failed to fetch lights: %v", err)
 		return err
 	}
@@ -302,11 +417,11 @@ func (hue *Hue) GetLights(resp *GetLightsResponse) error {
 type GetLightResponse Light
 
 // GetLight gets all of the information about a single light.
-func (hue *Hue) GetLight(id string, resp *GetLightResponse) error {
+func (hue *Hue) GetLight(ctx context.Context, id string, resp *GetLightResponse) error {
 
 	path := "/api/" + hue.UserName + "/lights/" + id
 
-	if err := hue.get(path, resp); err != nil {
+	if err := hue.get(ctx, path, resp); err != nil {
 		log.Printf("Failed to fetch light: %v", err)
 		return err
 	}
@@ -317,10 +432,44 @@ func (hue *Hue) GetLight(id string, resp *GetLightResponse) error {
 // PutLightRequest is the input to the PutLight method.
 // All of the members are pointers because they are optional.
 type PutLightRequest struct {
-	On  *bool `json:"on,omitempty"`
-	Hue *int  `json:"hue,omitempty"`
-	Sat *int  `json:"sat,omitempty"`
-	Bri *int  `json:"bri,omitempty"`
+	On             *bool       `json:"on,omitempty"`
+	Hue            *int        `json:"hue,omitempty"`
+	Sat            *int        `json:"sat,omitempty"`
+	Bri            *int        `json:"bri,omitempty"`
+	XY             *[2]float64 `json:"xy,omitempty"`
+	CT             *int        `json:"ct,omitempty"`
+	Alert          *string     `json:"alert,omitempty"`
+	Effect         *string     `json:"effect,omitempty"`
+	TransitionTime *uint16     `json:"transitiontime,omitempty"`
+}
+
+// SetRGB sets the light's xy chromaticity and brightness from an 8-bit sRGB
+// color, converting through CIE 1931 space and clamping to the color gamut
+// of a typical (model B) Hue bulb.
+func (req *PutLightRequest) SetRGB(r, g, b uint8) {
+	x, y, y1931 := color.RGBToXY(r, g, b, color.GamutB)
+
+	xy := [2]float64{x, y}
+	req.XY = &xy
+
+	bri := int(y1931 * 254)
+	if bri < 1 {
+		bri = 1
+	} else if bri > 254 {
+		bri = 254
+	}
+	req.Bri = &bri
+}
+
+// SetKelvin sets the light's color temperature, converting the given Kelvin
+// value to the mireds used by the bridge's ct field. Non-positive kelvin is
+// not a valid color temperature and is ignored.
+func (req *PutLightRequest) SetKelvin(kelvin int) {
+	if kelvin <= 0 {
+		return
+	}
+	ct := color.KelvinToMired(kelvin)
+	req.CT = &ct
 }
 
 type putLightResponse []struct {
@@ -328,12 +477,269 @@ type putLightResponse []struct {
 }
 
 // PutLight changes the state of a light to the parameters specified in state.
-func (hue *Hue) PutLight(id string, state *PutLightRequest) error {
+func (hue *Hue) PutLight(ctx context.Context, id string, state *PutLightRequest) error {
 
 	path := "/api/" + hue.UserName + "/lights/" + id + "/state"
 
 	var respBody putLightResponse
-	if err := hue.put(path, state, &respBody); err != nil {
+	if err := hue.put(ctx, path, state, &respBody); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PutLights changes the state of multiple lights in as few HTTP round trips
+// as possible. For more than one light, it creates a temporary group
+// containing the given ids, PUTs the state to the group's action endpoint
+// once, and deletes the group again, rather than issuing a PUT per light.
+// This avoids tripping the bridge's rate limiting when controlling many
+// lights at once. It falls back to a PUT per light when only one id is
+// given, or if creating or using the temporary group fails.
+func (hue *Hue) PutLights(ctx context.Context, ids []string, state *PutLightRequest) error {
+	if len(ids) == 1 {
+		return hue.PutLight(ctx, ids[0], state)
+	}
+
+	if len(ids) > 1 {
+		groupId, err := hue.CreateGroup(ctx, "hue-temp-group", ids)
+		if err != nil {
+			log.Printf("Failed to create temporary group, falling back to per-light PUT: %v", err)
+		} else {
+			putErr := hue.PutGroupState(ctx, groupId, state)
+			if delErr := hue.DeleteGroup(ctx, groupId); delErr != nil {
+				log.Printf("Failed to delete temporary group %v: %v", groupId, delErr)
+			}
+			if putErr == nil {
+				return nil
+			}
+			log.Printf("Failed to put state to temporary group, falling back to per-light PUT: %v", putErr)
+		}
+	}
+
+	for _, id := range ids {
+		if err := hue.PutLight(ctx, id, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Group contains all of the info about a group of lights.
+type Group struct {
+	Name   string
+	Lights []string
+	Type   string
+	Action LightState
+}
+
+// GetGroupsResponse is the structure returned by GetGroups.
+type GetGroupsResponse map[string]Group
+
+// GetGroups returns information about all of the groups.
+func (hue *Hue) GetGroups(ctx context.Context, resp *GetGroupsResponse) error {
+
+	path := "/api/" + hue.UserName + "/groups"
+
+	if err := hue.get(ctx, path, resp); err != nil {
+		log.Printf("Failed to fetch groups: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetGroupResponse is the result of the GetGroup function.
+type GetGroupResponse Group
+
+// GetGroup gets all of the information about a single group.
+func (hue *Hue) GetGroup(ctx context.Context, id string, resp *GetGroupResponse) error {
+
+	path := "/api/" + hue.UserName + "/groups/" + id
+
+	if err := hue.get(ctx, path, resp); err != nil {
+		log.Printf("Failed to fetch group: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+type createGroupRequest struct {
+	Name   string   `json:"name"`
+	Lights []string `json:"lights"`
+}
+
+type createGroupResponse []struct {
+	Success struct {
+		Id string `json:"id"`
+	}
+}
+
+// CreateGroup creates a new group containing the given lights and returns its id.
+func (hue *Hue) CreateGroup(ctx context.Context, name string, lights []string) (string, error) {
+
+	path := "/api/" + hue.UserName + "/groups"
+
+	reqBody := &createGroupRequest{name, lights}
+
+	var respBody createGroupResponse
+	if err := hue.post(ctx, path, reqBody, &respBody); err != nil {
+		log.Printf("Failed to create group: %v", err)
+		return "", err
+	}
+
+	if len(respBody) == 0 {
+		err := fmt.Errorf("No id returned when creating group")
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	return respBody[0].Success.Id, nil
+}
+
+// PutGroupState changes the state of every light in a group to the parameters specified in state.
+func (hue *Hue) PutGroupState(ctx context.Context, id string, state *PutLightRequest) error {
+
+	path := "/api/" + hue.UserName + "/groups/" + id + "/action"
+
+	var respBody putLightResponse
+	if err := hue.put(ctx, path, state, &respBody); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteGroup removes a group from the hub.
+func (hue *Hue) DeleteGroup(ctx context.Context, id string) error {
+
+	path := "/api/" + hue.UserName + "/groups/" + id
+
+	var respBody deleteResponse
+	if err := hue.delete(ctx, path, &respBody); err != nil {
+		log.Printf("Failed to delete group: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Scene contains all of the info about a stored scene. Id is not part of
+// the bridge's JSON representation; it is filled in by GetScene/GetScenes
+// so that the Scene can later be passed to Apply.
+type Scene struct {
+	Id      string `json:"-"`
+	Name    string
+	Lights  []string
+	Owner   string
+	Recycle bool
+	Locked  bool
+	Active  bool
+}
+
+// GetScenesResponse is the structure returned by GetScenes.
+type GetScenesResponse map[string]Scene
+
+// GetScenes returns information about all of the scenes.
+func (hue *Hue) GetScenes(ctx context.Context, resp *GetScenesResponse) error {
+
+	path := "/api/" + hue.UserName + "/scenes"
+
+	if err := hue.get(ctx, path, resp); err != nil {
+		log.Printf("Failed to fetch scenes: %v", err)
+		return err
+	}
+
+	for id, scene := range *resp {
+		scene.Id = id
+		(*resp)[id] = scene
+	}
+
+	return nil
+}
+
+// GetSceneResponse is the result of the GetScene function.
+type GetSceneResponse Scene
+
+// GetScene gets all of the information about a single scene.
+func (hue *Hue) GetScene(ctx context.Context, id string, resp *GetSceneResponse) error {
+
+	path := "/api/" + hue.UserName + "/scenes/" + id
+
+	if err := hue.get(ctx, path, resp); err != nil {
+		log.Printf("Failed to fetch scene: %v", err)
+		return err
+	}
+	resp.Id = id
+
+	return nil
+}
+
+// Apply activates this scene on the bridge by PUTting a scene recall to the
+// all-lights group (group 0), letting the bridge restore each light's
+// stored state in a single request.
+func (scene *Scene) Apply(ctx context.Context, hue *Hue) error {
+	if scene.Id == "" {
+		return fmt.Errorf("scene %q has no id; fetch it via GetScene or GetScenes first", scene.Name)
+	}
+
+	path := "/api/" + hue.UserName + "/groups/0/action"
+	reqBody := &struct {
+		Scene string `json:"scene"`
+	}{scene.Id}
+
+	var respBody putLightResponse
+	if err := hue.put(ctx, path, reqBody, &respBody); err != nil {
+		log.Printf("Failed to apply scene %v: %v", scene.Id, err)
+		return err
+	}
+
+	return nil
+}
+
+type createSceneRequest struct {
+	Name   string   `json:"name"`
+	Lights []string `json:"lights"`
+}
+
+type createSceneResponse []struct {
+	Success struct {
+		Id string `json:"id"`
+	}
+}
+
+// CreateScene stores the current state of the given lights as a new scene and returns its id.
+func (hue *Hue) CreateScene(ctx context.Context, name string, lights []string) (string, error) {
+
+	path := "/api/" + hue.UserName + "/scenes"
+
+	reqBody := &createSceneRequest{name, lights}
+
+	var respBody createSceneResponse
+	if err := hue.post(ctx, path, reqBody, &respBody); err != nil {
+		log.Printf("Failed to create scene: %v", err)
+		return "", err
+	}
+
+	if len(respBody) == 0 {
+		err := fmt.Errorf("No id returned when creating scene")
+		log.Printf("%v", err)
+		return "", err
+	}
+
+	return respBody[0].Success.Id, nil
+}
+
+// DeleteScene removes a scene from the hub.
+func (hue *Hue) DeleteScene(ctx context.Context, id string) error {
+
+	path := "/api/" + hue.UserName + "/scenes/" + id
+
+	var respBody deleteResponse
+	if err := hue.delete(ctx, path, &respBody); err != nil {
+		log.Printf("Failed to delete scene: %v", err)
 		return err
 	}
 
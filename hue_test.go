@@ -0,0 +1,121 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransportRoundTrip(t *testing.T) {
+	t.Run("retries on 429 then succeeds", func(t *testing.T) {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := &http.Client{Transport: &RetryTransport{MaxRetries: 3, InitialBackoff: time.Millisecond}}
+
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("RoundTrip returned error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("final status = %v, want 200", resp.StatusCode)
+		}
+		if got := atomic.LoadInt32(&attempts); got != 2 {
+			t.Errorf("server saw %v requests, want 2 (1 initial + 1 retry)", got)
+		}
+	})
+
+	t.Run("retries on 503 then succeeds", func(t *testing.T) {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := &http.Client{Transport: &RetryTransport{MaxRetries: 3, InitialBackoff: time.Millisecond}}
+
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("RoundTrip returned error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("final status = %v, want 200", resp.StatusCode)
+		}
+		if got := atomic.LoadInt32(&attempts); got != 3 {
+			t.Errorf("server saw %v requests, want 3 (1 initial + 2 retries)", got)
+		}
+	})
+
+	t.Run("gives up after MaxRetries", func(t *testing.T) {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		client := &http.Client{Transport: &RetryTransport{MaxRetries: 2, InitialBackoff: time.Millisecond}}
+
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("RoundTrip returned error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("final status = %v, want 503", resp.StatusCode)
+		}
+		if got := atomic.LoadInt32(&attempts); got != 3 {
+			t.Errorf("server saw %v requests, want 3 (1 initial + 2 retries)", got)
+		}
+	})
+
+	t.Run("respects ctx cancellation during backoff", func(t *testing.T) {
+		first := make(chan struct{}, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case first <- struct{}{}:
+			default:
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		client := &http.Client{Transport: &RetryTransport{MaxRetries: 5, InitialBackoff: time.Second}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-first
+			cancel()
+		}()
+
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+		if err != nil {
+			t.Fatalf("NewRequestWithContext failed: %v", err)
+		}
+
+		_, err = client.Do(req)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("RoundTrip error = %v, want context.Canceled", err)
+		}
+	})
+}